@@ -0,0 +1,213 @@
+// Package bits provides word-backed bitset primitives and higher-level
+// range allocators, such as PortRange, built on top of them.
+package bits
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const wordSize = 64
+
+// ErrNoBitAvailable is returned when an allocation request cannot be
+// satisfied because not enough unset bits remain.
+var ErrNoBitAvailable = errors.New("bits: no bit available")
+
+// BitField is a fixed-size bitset backed by a slice of 64-bit words, safe
+// for concurrent use by multiple goroutines.
+//
+// Single-bit operations (SetBit, ClearBit, IsSet) are lock-free: each one
+// does a compare-and-swap loop on the target word. Multi-bit allocations
+// (AllocateNextAvailableBits, AllocateAvailableBitsInRange) take mu for
+// their scan-and-commit critical section, so two concurrent allocations
+// never hand out the same bit.
+//
+// By default, allocations always scan from bit 0. When constructed with
+// serial mode enabled (see NewBitFieldWithOptions), allocations instead
+// resume from just past the last bit handed out and wrap around, which
+// gives recently-freed bits a long cooling-off period before reuse.
+type BitField struct {
+	mu     sync.Mutex
+	bits   []atomic.Uint64
+	size   int
+	serial bool
+	curr   int
+}
+
+// NewBitField returns a BitField able to hold size bits, all initially
+// unset.
+func NewBitField(size int) *BitField {
+	return NewBitFieldWithOptions(size, false)
+}
+
+// NewBitFieldWithOptions returns a BitField able to hold size bits. When
+// serial is true, AllocateNextAvailableBits resumes scanning from its
+// internal cursor instead of always starting at bit 0.
+func NewBitFieldWithOptions(size int, serial bool) *BitField {
+	words := (size + wordSize - 1) / wordSize
+	return &BitField{
+		bits:   make([]atomic.Uint64, words),
+		size:   size,
+		serial: serial,
+	}
+}
+
+// SetBit marks bit i as set. It is safe to call concurrently with any other
+// BitField method.
+func (bf *BitField) SetBit(i int) {
+	word := &bf.bits[i/wordSize]
+	mask := uint64(1) << uint(i%wordSize)
+	for {
+		old := word.Load()
+		if old&mask != 0 {
+			return
+		}
+		if word.CompareAndSwap(old, old|mask) {
+			return
+		}
+	}
+}
+
+// ClearBit marks bit i as unset. It is safe to call concurrently with any
+// other BitField method.
+func (bf *BitField) ClearBit(i int) {
+	word := &bf.bits[i/wordSize]
+	mask := uint64(1) << uint(i%wordSize)
+	for {
+		old := word.Load()
+		if old&mask == 0 {
+			return
+		}
+		if word.CompareAndSwap(old, old&^mask) {
+			return
+		}
+	}
+}
+
+// IsSet reports whether bit i is set.
+func (bf *BitField) IsSet(i int) bool {
+	mask := uint64(1) << uint(i%wordSize)
+	return bf.bits[i/wordSize].Load()&mask != 0
+}
+
+// trySetBit atomically sets bit i and reports whether this call was the one
+// that flipped it from 0 to 1. Unlike a separate IsSet-then-SetBit, this is
+// a single CAS, so two callers racing on the same bit can never both
+// believe they won it.
+func (bf *BitField) trySetBit(i int) bool {
+	word := &bf.bits[i/wordSize]
+	mask := uint64(1) << uint(i%wordSize)
+	for {
+		old := word.Load()
+		if old&mask != 0 {
+			return false
+		}
+		if word.CompareAndSwap(old, old|mask) {
+			return true
+		}
+	}
+}
+
+// AllocateNextAvailableBits finds the first n unset bits, marks them set,
+// and returns their positions in the order they were found. In non-serial
+// mode the scan always starts at bit 0; in serial mode it resumes from the
+// cursor left by the previous call and wraps around the field.
+func (bf *BitField) AllocateNextAvailableBits(n int) ([]int, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("bits: invalid bit count %d", n)
+	}
+	if n > bf.size {
+		return nil, fmt.Errorf("bits: requested %d bits but field only holds %d", n, bf.size)
+	}
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	start := 0
+	if bf.serial {
+		start = bf.curr
+	}
+
+	allocated := make([]int, 0, n)
+	last := start
+	for i := start; i < bf.size && len(allocated) < n; i++ {
+		if bf.trySetBit(i) {
+			allocated = append(allocated, i)
+			last = i
+		}
+	}
+	if bf.serial {
+		for i := 0; i < start && len(allocated) < n; i++ {
+			if bf.trySetBit(i) {
+				allocated = append(allocated, i)
+				last = i
+			}
+		}
+	}
+
+	if len(allocated) < n {
+		// A partial scan must not leave bits allocated that the caller was
+		// never told about and can never release.
+		for _, i := range allocated {
+			bf.ClearBit(i)
+		}
+		return nil, fmt.Errorf("%w: requested %d, found %d", ErrNoBitAvailable, n, len(allocated))
+	}
+	if bf.serial {
+		bf.curr = (last + 1) % bf.size
+		// The wrap-around half of the scan is appended after the tail
+		// half, so a wrapped allocation comes back out of index order
+		// (e.g. [8, 9, 0]); re-sort so callers still get the ascending
+		// order AllocateNextPorts promises.
+		sort.Ints(allocated)
+	}
+	return allocated, nil
+}
+
+// AllocateAvailableBitsInRange behaves like AllocateNextAvailableBits but
+// restricts the search to the half-open range [start, end), always
+// scanning from start regardless of serial mode.
+func (bf *BitField) AllocateAvailableBitsInRange(start, end, n int) ([]int, error) {
+	if start < 0 || end > bf.size || start >= end {
+		return nil, fmt.Errorf("bits: invalid range [%d, %d)", start, end)
+	}
+	if n <= 0 || n > end-start {
+		return nil, fmt.Errorf("bits: invalid bit count %d for range [%d, %d)", n, start, end)
+	}
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	allocated := make([]int, 0, n)
+	for i := start; i < end && len(allocated) < n; i++ {
+		if bf.trySetBit(i) {
+			allocated = append(allocated, i)
+		}
+	}
+	if len(allocated) < n {
+		for _, i := range allocated {
+			bf.ClearBit(i)
+		}
+		return nil, fmt.Errorf("%w in range [%d, %d): requested %d, found %d", ErrNoBitAvailable, start, end, n, len(allocated))
+	}
+	return allocated, nil
+}
+
+// Free returns the number of currently unset bits.
+func (bf *BitField) Free() int {
+	free := 0
+	for w := range bf.bits {
+		word := bf.bits[w].Load()
+		if w == len(bf.bits)-1 {
+			if rem := bf.size - w*wordSize; rem < wordSize {
+				word |= ^uint64(0) << uint(rem) // ignore padding bits past bf.size
+			}
+		}
+		free += wordSize - bits.OnesCount64(word)
+	}
+	return free
+}
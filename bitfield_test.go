@@ -125,6 +125,49 @@ func TestAllocateNextAvailableBits(t *testing.T) {
 	}
 }
 
+func TestAllocateNextAvailableBitsRollsBackOnFailure(t *testing.T) {
+	bf := NewBitField(10)
+	bf.SetBit(7)
+	bf.SetBit(8)
+	bf.SetBit(9)
+
+	// Only 7 bits are free; asking for 8 must fail without permanently
+	// consuming the 7 it found along the way.
+	if _, err := bf.AllocateNextAvailableBits(8); err == nil {
+		t.Fatal("Expected error due to insufficient available bits")
+	}
+	if bf.Free() != 7 {
+		t.Fatalf("Expected a failed allocation to leave all scanned bits free, got %d free", bf.Free())
+	}
+
+	allocated, err := bf.AllocateNextAvailableBits(7)
+	if err != nil {
+		t.Fatalf("Unexpected error re-allocating the rolled-back bits: %v", err)
+	}
+	if len(allocated) != 7 {
+		t.Fatalf("Expected all 7 rolled-back bits to be available again, got %v", allocated)
+	}
+}
+
+func TestFree(t *testing.T) {
+	bf := NewBitField(10)
+	if got := bf.Free(); got != 10 {
+		t.Fatalf("Expected 10 free bits initially, got %d", got)
+	}
+
+	bf.SetBit(0)
+	bf.SetBit(9)
+	if got := bf.Free(); got != 8 {
+		t.Fatalf("Expected 8 free bits, got %d", got)
+	}
+
+	bf.ClearBit(0)
+	bf.ClearBit(9)
+	if got := bf.Free(); got != 10 {
+		t.Fatalf("Expected Free to return to its initial value, got %d", got)
+	}
+}
+
 func TestAllocateNextAvailableBitsInvalidInput(t *testing.T) {
 	bf := NewBitField(64)
 
@@ -213,3 +256,17 @@ func TestNextAvailableBitsInRange(t *testing.T) {
 		t.Errorf("Expected single available bit at position 0, got %v", availableBits)
 	}
 }
+
+func TestAllocateAvailableBitsInRangeRollsBackOnFailure(t *testing.T) {
+	bf := NewBitField(10)
+	freeBefore := bf.Free()
+
+	// Only 5 bits are free in [0, 5); asking for 6 must fail without
+	// permanently consuming the 5 it found along the way.
+	if _, err := bf.AllocateAvailableBitsInRange(0, 5, 6); err == nil {
+		t.Fatal("Expected error due to insufficient bits in range")
+	}
+	if got := bf.Free(); got != freeBefore {
+		t.Fatalf("Expected a failed ranged allocation to leave all scanned bits free, got %d free, want %d", got, freeBefore)
+	}
+}
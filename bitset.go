@@ -0,0 +1,19 @@
+package bits
+
+// BitSet is the storage interface PortRange allocates offsets from. Both
+// BitField (a flat bitmap, ideal for small-to-moderate ranges) and
+// SparseBitField (a lazily-paged bitmap, ideal for ranges in the millions)
+// implement it, so a PortRange can be parameterized by either.
+type BitSet interface {
+	SetBit(i int)
+	ClearBit(i int)
+	IsSet(i int) bool
+	AllocateNextAvailableBits(n int) ([]int, error)
+	AllocateAvailableBitsInRange(start, end, n int) ([]int, error)
+	Free() int
+}
+
+var (
+	_ BitSet = (*BitField)(nil)
+	_ BitSet = (*SparseBitField)(nil)
+)
@@ -0,0 +1,194 @@
+package bits
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestConcurrentAllocation exercises PortRange from many goroutines at once
+// and asserts that no port is ever handed out twice and that all ports are
+// eventually returned to the pool.
+func TestConcurrentAllocation(t *testing.T) {
+	const (
+		numPorts        = 1000
+		numGoroutines   = 50
+		opsPerGoroutine = 200
+	)
+
+	pr, err := NewPortRange(10000, numPorts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		owned = make(map[int]bool)
+		wg    sync.WaitGroup
+	)
+
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < opsPerGoroutine; i++ {
+				ports, err := pr.AllocateNextPorts(1)
+				if err != nil {
+					continue
+				}
+				port := ports[0]
+
+				mu.Lock()
+				if owned[port] {
+					mu.Unlock()
+					t.Errorf("port %d allocated twice", port)
+					continue
+				}
+				owned[port] = true
+				mu.Unlock()
+
+				mu.Lock()
+				delete(owned, port)
+				mu.Unlock()
+
+				if err := pr.ReleasePorts(ports); err != nil {
+					t.Errorf("Unexpected error releasing port %d: %v", port, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	free, err := pr.AllocateNextPorts(numPorts)
+	if err != nil {
+		t.Fatalf("Expected every port to be free again, got error: %v", err)
+	}
+	if len(free) != numPorts {
+		t.Fatalf("Expected %d free ports, got %d", numPorts, len(free))
+	}
+}
+
+// TestConcurrentAllocationWithSetPortAllocated mixes scan-based allocation
+// (AllocateNextPorts) with the lock-free single-bit setter reachable via
+// SetPortAllocated, over a small shared range so the two paths repeatedly
+// contend for the same bits. A regression that goes back to checking IsSet
+// and then calling SetBit as two separate steps inside the scan (instead of
+// one atomic compare-and-swap) would let AllocateNextPorts hand out a port
+// that SetPortAllocated is concurrently holding.
+func TestConcurrentAllocationWithSetPortAllocated(t *testing.T) {
+	const (
+		numPorts        = 8
+		numGoroutines   = 50
+		opsPerGoroutine = 500
+	)
+
+	pr, err := NewPortRange(50000, numPorts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		owned = make(map[int]bool) // ports currently claimed via AllocateNextPorts
+		held  = make(map[int]bool) // ports currently held via SetPortAllocated
+		wg    sync.WaitGroup
+	)
+
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := 0; i < opsPerGoroutine; i++ {
+				if id%2 == 0 {
+					ports, err := pr.AllocateNextPorts(1)
+					if err != nil {
+						continue
+					}
+					port := ports[0]
+
+					mu.Lock()
+					if held[port] {
+						t.Errorf("AllocateNextPorts returned port %d while SetPortAllocated held it", port)
+					}
+					if owned[port] {
+						t.Errorf("port %d allocated twice", port)
+					}
+					owned[port] = true
+					mu.Unlock()
+
+					mu.Lock()
+					delete(owned, port)
+					mu.Unlock()
+
+					if err := pr.ReleasePorts(ports); err != nil {
+						t.Errorf("Unexpected error releasing port %d: %v", port, err)
+					}
+				} else {
+					port := 50000 + (i % numPorts)
+					if err := pr.SetPortAllocated(port); err != nil {
+						t.Errorf("Unexpected error setting port %d: %v", port, err)
+						continue
+					}
+
+					mu.Lock()
+					held[port] = true
+					mu.Unlock()
+
+					mu.Lock()
+					delete(held, port)
+					mu.Unlock()
+
+					if err := pr.ReleasePorts([]int{port}); err != nil {
+						t.Errorf("Unexpected error releasing port %d: %v", port, err)
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// TestConcurrentAllocationMultiBitInsufficientCapacity drives many
+// goroutines to each request more bits than the field can usually satisfy
+// at once, so most calls fail with ErrNoBitAvailable. A regression that
+// commits bits during a failed scan without rolling them back would leak
+// capacity on every failed call, and the field would never again be able
+// to satisfy a full-capacity allocation.
+func TestConcurrentAllocationMultiBitInsufficientCapacity(t *testing.T) {
+	const (
+		numBits         = 8
+		request         = 5 // more than half the field, so concurrent holders routinely starve each other
+		numGoroutines   = 50
+		opsPerGoroutine = 200
+	)
+
+	bf := NewBitField(numBits)
+
+	var wg sync.WaitGroup
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < opsPerGoroutine; i++ {
+				allocated, err := bf.AllocateNextAvailableBits(request)
+				if err != nil {
+					continue
+				}
+				for _, i := range allocated {
+					bf.ClearBit(i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := bf.Free(); got != numBits {
+		t.Fatalf("Expected all %d bits free after the run, got %d free", numBits, got)
+	}
+	full, err := bf.AllocateNextAvailableBits(numBits)
+	if err != nil {
+		t.Fatalf("Expected the full field to be allocatable after the run, got error: %v", err)
+	}
+	if len(full) != numBits {
+		t.Fatalf("Expected %d bits, got %d", numBits, len(full))
+	}
+}
@@ -0,0 +1,189 @@
+package bits
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrPortAllocated is returned by PortAllocator.RequestPort when a specific
+// port was requested but is already in use.
+var ErrPortAllocated = errors.New("bits: port already allocated")
+
+// validProtocols lists the protocols a PortAllocator will track separately.
+var validProtocols = map[string]bool{
+	"tcp":  true,
+	"udp":  true,
+	"sctp": true,
+}
+
+// ParsePortRange parses a "start-end" string, such as "30000-32767", into
+// its inclusive bounds.
+func ParsePortRange(s string) (begin, end int, err error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("bits: invalid port range %q, expected \"start-end\"", s)
+	}
+	begin, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("bits: invalid start port in range %q: %w", s, err)
+	}
+	end, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("bits: invalid end port in range %q: %w", s, err)
+	}
+	if begin <= 0 || end < begin {
+		return 0, 0, fmt.Errorf("bits: invalid port range %q", s)
+	}
+	return begin, end, nil
+}
+
+// PortAllocatorOptions configures a PortAllocator.
+type PortAllocatorOptions struct {
+	// AllowPrivileged permits RequestPort to hand out ports below 1024.
+	AllowPrivileged bool
+}
+
+// portKey scopes an allocation to one IP and protocol.
+type portKey struct {
+	ip    string
+	proto string
+}
+
+// PortAllocator is a higher-level port-management subsystem for
+// network/daemon-style users. It keys allocations by (ip, protocol),
+// maintaining one PortRange per pair, created on demand from a shared
+// [Begin, End] window.
+type PortAllocator struct {
+	mu     sync.Mutex
+	begin  int
+	end    int
+	allow  bool
+	ranges map[portKey]*PortRange
+}
+
+// NewPortAllocator returns a PortAllocator that hands out ports from the
+// inclusive window described by portRange (a "start-end" string, as parsed
+// by ParsePortRange).
+func NewPortAllocator(portRange string, opts PortAllocatorOptions) (*PortAllocator, error) {
+	begin, end, err := ParsePortRange(portRange)
+	if err != nil {
+		return nil, err
+	}
+	return &PortAllocator{
+		begin:  begin,
+		end:    end,
+		allow:  opts.AllowPrivileged,
+		ranges: make(map[portKey]*PortRange),
+	}, nil
+}
+
+func normalizeProto(proto string) (string, error) {
+	p := strings.ToLower(proto)
+	if !validProtocols[p] {
+		return "", fmt.Errorf("bits: unsupported protocol %q", proto)
+	}
+	return p, nil
+}
+
+// rangeForLocked returns the PortRange for key, creating it on demand.
+// pa.mu must be held.
+func (pa *PortAllocator) rangeForLocked(key portKey) (*PortRange, error) {
+	if pr, ok := pa.ranges[key]; ok {
+		return pr, nil
+	}
+	pr, err := NewPortRange(pa.begin, pa.end-pa.begin+1)
+	if err != nil {
+		return nil, err
+	}
+	pa.ranges[key] = pr
+	return pr, nil
+}
+
+// RequestPort allocates port on (ip, proto). A port of 0 means "any free
+// port" within the allocator's range. Ports below 1024 are rejected unless
+// the allocator was constructed with AllowPrivileged.
+func (pa *PortAllocator) RequestPort(ip net.IP, proto string, port int) (int, error) {
+	proto, err := normalizeProto(proto)
+	if err != nil {
+		return 0, err
+	}
+	if port != 0 && port < 1024 && !pa.allow {
+		return 0, fmt.Errorf("bits: port %d is privileged and AllowPrivileged is not set", port)
+	}
+	if port != 0 && (port < pa.begin || port > pa.end) {
+		return 0, fmt.Errorf("bits: port %d is outside the allocator's range [%d, %d]", port, pa.begin, pa.end)
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	pr, err := pa.rangeForLocked(portKey{ip: ip.String(), proto: proto})
+	if err != nil {
+		return 0, err
+	}
+
+	if port == 0 {
+		// "Any free port" must still honor the privileged-port guard: when
+		// AllowPrivileged is false, restrict the scan to offsets at or
+		// above 1024 so this path can't hand out a privileged port.
+		lo := pa.begin
+		if !pa.allow && lo < 1024 {
+			lo = 1024
+		}
+		if lo > pa.end {
+			return 0, fmt.Errorf("bits: no unprivileged ports available in range [%d, %d]", pa.begin, pa.end)
+		}
+		indices, err := pr.bitField.AllocateAvailableBitsInRange(lo-pa.begin, pa.end-pa.begin+1, 1)
+		if err != nil {
+			return 0, err
+		}
+		return pa.begin + indices[0], nil
+	}
+
+	isAllocated, err := pr.IsPortAllocated(port)
+	if err != nil {
+		return 0, err
+	}
+	if isAllocated {
+		return 0, ErrPortAllocated
+	}
+	if err := pr.SetPortAllocated(port); err != nil {
+		return 0, err
+	}
+	return port, nil
+}
+
+// ReleasePort frees port on (ip, proto) so it can be requested again.
+func (pa *PortAllocator) ReleasePort(ip net.IP, proto string, port int) error {
+	proto, err := normalizeProto(proto)
+	if err != nil {
+		return err
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	key := portKey{ip: ip.String(), proto: proto}
+	pr, ok := pa.ranges[key]
+	if !ok {
+		return fmt.Errorf("bits: no ports have been allocated for %s/%s", ip, proto)
+	}
+	return pr.ReleasePorts([]int{port})
+}
+
+// ReleaseAll frees every port allocated for ip, across all protocols.
+func (pa *PortAllocator) ReleaseAll(ip net.IP) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	ipStr := ip.String()
+	for key := range pa.ranges {
+		if key.ip == ipStr {
+			delete(pa.ranges, key)
+		}
+	}
+}
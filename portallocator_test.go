@@ -0,0 +1,148 @@
+package bits
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	begin, end, err := ParsePortRange("30000-32767")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if begin != 30000 || end != 32767 {
+		t.Errorf("Expected [30000, 32767], got [%d, %d]", begin, end)
+	}
+
+	if _, _, err := ParsePortRange("not-a-range"); err == nil {
+		t.Fatal("Expected error for malformed port range")
+	}
+	if _, _, err := ParsePortRange("100-50"); err == nil {
+		t.Fatal("Expected error for end before start")
+	}
+}
+
+func TestPortAllocatorRequestAnyPort(t *testing.T) {
+	pa, err := NewPortAllocator("30000-30010", PortAllocatorOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+	port, err := pa.RequestPort(ip, "tcp", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if port < 30000 || port > 30010 {
+		t.Errorf("Expected port within range, got %d", port)
+	}
+
+	// Requesting the same explicit port again should fail.
+	if _, err := pa.RequestPort(ip, "tcp", port); err != ErrPortAllocated {
+		t.Fatalf("Expected ErrPortAllocated, got %v", err)
+	}
+
+	// The same port on a different protocol is independent.
+	if _, err := pa.RequestPort(ip, "udp", port); err != nil {
+		t.Fatalf("Unexpected error allocating same port on a different protocol: %v", err)
+	}
+}
+
+func TestPortAllocatorReleasePort(t *testing.T) {
+	pa, err := NewPortAllocator("30000-30010", PortAllocatorOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+	if _, err := pa.RequestPort(ip, "tcp", 30005); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pa.ReleasePort(ip, "tcp", 30005); err != nil {
+		t.Fatalf("Unexpected error releasing: %v", err)
+	}
+	if _, err := pa.RequestPort(ip, "tcp", 30005); err != nil {
+		t.Fatalf("Expected port to be available again, got error: %v", err)
+	}
+}
+
+func TestPortAllocatorReleaseAll(t *testing.T) {
+	pa, err := NewPortAllocator("30000-30010", PortAllocatorOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+	if _, err := pa.RequestPort(ip, "tcp", 30005); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := pa.RequestPort(ip, "udp", 30006); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pa.ReleaseAll(ip)
+
+	if _, err := pa.RequestPort(ip, "tcp", 30005); err != nil {
+		t.Fatalf("Expected port to be free after ReleaseAll, got error: %v", err)
+	}
+	if _, err := pa.RequestPort(ip, "udp", 30006); err != nil {
+		t.Fatalf("Expected port to be free after ReleaseAll, got error: %v", err)
+	}
+}
+
+func TestPortAllocatorOutOfRangeDoesNotLeakRange(t *testing.T) {
+	pa, err := NewPortAllocator("30000-30010", PortAllocatorOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		ip := net.ParseIP(fmt.Sprintf("10.0.0.%d", i))
+		if _, err := pa.RequestPort(ip, "tcp", 99999); err == nil {
+			t.Fatal("Expected error requesting an out-of-range port")
+		}
+	}
+
+	if len(pa.ranges) != 0 {
+		t.Errorf("Expected no PortRange to be cached after only failed requests, got %d", len(pa.ranges))
+	}
+}
+
+func TestPortAllocatorPrivilegedPorts(t *testing.T) {
+	pa, err := NewPortAllocator("1-30010", PortAllocatorOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+	if _, err := pa.RequestPort(ip, "tcp", 80); err == nil {
+		t.Fatal("Expected error requesting a privileged port without AllowPrivileged")
+	}
+
+	paPriv, err := NewPortAllocator("1-30010", PortAllocatorOptions{AllowPrivileged: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := paPriv.RequestPort(ip, "tcp", 80); err != nil {
+		t.Fatalf("Unexpected error requesting a privileged port with AllowPrivileged: %v", err)
+	}
+}
+
+func TestPortAllocatorRequestAnyPortExcludesPrivileged(t *testing.T) {
+	pa, err := NewPortAllocator("1-30010", PortAllocatorOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+	for i := 0; i < 1024; i++ {
+		port, err := pa.RequestPort(ip, "tcp", 0)
+		if err != nil {
+			t.Fatalf("Unexpected error on request %d: %v", i, err)
+		}
+		if port < 1024 {
+			t.Fatalf("Expected only unprivileged ports from port==0 without AllowPrivileged, got %d", port)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package bits
+
+import "fmt"
+
+// PortRange allocates ports from the contiguous block
+// [startPort, startPort+size) using a BitSet to track which offsets are
+// currently in use.
+type PortRange struct {
+	startPort int
+	size      int
+	bitField  BitSet
+}
+
+// NewPortRange returns a PortRange covering size ports starting at startPort.
+func NewPortRange(startPort, size int) (*PortRange, error) {
+	return NewPortRangeWithOptions(startPort, size, false)
+}
+
+// NewPortRangeWithOptions returns a PortRange covering size ports starting
+// at startPort. When serial is true, AllocateNextPorts resumes handing out
+// ports from just past the last one allocated and wraps around, instead of
+// always starting at startPort. This gives a recently-released port a long
+// cooling-off period before it is reissued, which matters for TCP ports
+// where TIME_WAIT and conntrack state make immediate reuse unsafe.
+func NewPortRangeWithOptions(startPort, size int, serial bool) (*PortRange, error) {
+	if startPort < 0 {
+		return nil, fmt.Errorf("bits: start port must not be negative, got %d", startPort)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("bits: size must be positive, got %d", size)
+	}
+	return &PortRange{
+		startPort: startPort,
+		size:      size,
+		bitField:  NewBitFieldWithOptions(size, serial),
+	}, nil
+}
+
+// NewLargePortRange returns a PortRange covering size ports starting at
+// startPort, backed by a SparseBitField instead of a flat BitField. Use
+// this for ranges in the millions — e.g. the full 1-65535 port space
+// replicated across many IPs, or an IPAM-style /16 address pool — where a
+// flat bitmap would allocate far more memory than is ever touched.
+func NewLargePortRange(startPort, size int) (*PortRange, error) {
+	if startPort < 0 {
+		return nil, fmt.Errorf("bits: start port must not be negative, got %d", startPort)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("bits: size must be positive, got %d", size)
+	}
+	return &PortRange{
+		startPort: startPort,
+		size:      size,
+		bitField:  NewSparseBitField(size),
+	}, nil
+}
+
+// indexOf translates a port number into its bit offset, failing if the port
+// falls outside the range.
+func (pr *PortRange) indexOf(port int) (int, error) {
+	i := port - pr.startPort
+	if i < 0 || i >= pr.size {
+		return 0, fmt.Errorf("bits: port %d is outside range [%d, %d)", port, pr.startPort, pr.startPort+pr.size)
+	}
+	return i, nil
+}
+
+// AllocateNextPorts allocates n ports, returning them in ascending order.
+func (pr *PortRange) AllocateNextPorts(n int) ([]int, error) {
+	indices, err := pr.bitField.AllocateNextAvailableBits(n)
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]int, len(indices))
+	for i, idx := range indices {
+		ports[i] = pr.startPort + idx
+	}
+	return ports, nil
+}
+
+// ReleasePorts marks the given ports as free again.
+func (pr *PortRange) ReleasePorts(ports []int) error {
+	for _, port := range ports {
+		i, err := pr.indexOf(port)
+		if err != nil {
+			return err
+		}
+		pr.bitField.ClearBit(i)
+	}
+	return nil
+}
+
+// IsPortAllocated reports whether port is currently allocated.
+func (pr *PortRange) IsPortAllocated(port int) (bool, error) {
+	i, err := pr.indexOf(port)
+	if err != nil {
+		return false, err
+	}
+	return pr.bitField.IsSet(i), nil
+}
+
+// SetPortAllocated marks port as allocated.
+func (pr *PortRange) SetPortAllocated(port int) error {
+	i, err := pr.indexOf(port)
+	if err != nil {
+		return err
+	}
+	pr.bitField.SetBit(i)
+	return nil
+}
+
+// Free returns the number of currently unallocated ports in the range.
+func (pr *PortRange) Free() int {
+	return pr.bitField.Free()
+}
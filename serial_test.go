@@ -0,0 +1,73 @@
+package bits
+
+import "testing"
+
+func TestAllocateNextAvailableBitsSerial(t *testing.T) {
+	bf := NewBitFieldWithOptions(10, true)
+
+	first, err := bf.AllocateNextAvailableBits(3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(first) != 3 || first[0] != 0 || first[2] != 2 {
+		t.Fatalf("Expected first allocation to start at 0, got %v", first)
+	}
+
+	// Release the bits we just handed out; a serial field must not reuse
+	// them immediately even though they are free again.
+	for _, i := range first {
+		bf.ClearBit(i)
+	}
+
+	second, err := bf.AllocateNextAvailableBits(3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{3, 4, 5}
+	for i, pos := range second {
+		if pos != expected[i] {
+			t.Errorf("Expected serial allocation to resume past the cursor, got %v", second)
+		}
+	}
+
+	// Exhaust the tail of the field so the next allocation must wrap.
+	if _, err := bf.AllocateNextAvailableBits(4); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wrapped, err := bf.AllocateNextAvailableBits(3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = []int{0, 1, 2}
+	for i, pos := range wrapped {
+		if pos != expected[i] {
+			t.Errorf("Expected allocation to wrap to the start of the field, got %v", wrapped)
+		}
+	}
+}
+
+func TestPortRangeAllocateSerial(t *testing.T) {
+	pr, err := NewPortRangeWithOptions(8000, 5, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	allocated, err := pr.AllocateNextPorts(2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pr.ReleasePorts(allocated); err != nil {
+		t.Fatalf("Unexpected error releasing: %v", err)
+	}
+
+	next, err := pr.AllocateNextPorts(2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{8002, 8003}
+	for i, port := range next {
+		if port != expected[i] {
+			t.Errorf("Expected serial port allocation to skip just-released ports, got %v", next)
+		}
+	}
+}
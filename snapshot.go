@@ -0,0 +1,137 @@
+package bits
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrMismatchedRange is returned by PortRange.Restore when the snapshot
+// being restored was taken from a range with a different startPort or size
+// than the PortRange it is being restored into.
+var ErrMismatchedRange = errors.New("bits: snapshot range does not match port range")
+
+// bitFieldSnapshot is the on-disk representation of a BitField: its bit
+// count, its serial-mode cursor, and a base64-encoded copy of its backing
+// words.
+type bitFieldSnapshot struct {
+	Size   int    `json:"size"`
+	Curr   int    `json:"curr"`
+	Bitmap string `json:"bitmap"`
+}
+
+// Snapshot writes a compact, JSON-encoded representation of bf to w so it
+// can be reconstructed later with Restore. This lets long-lived allocators
+// persist their state across process restarts.
+func (bf *BitField) Snapshot(w io.Writer) error {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return json.NewEncoder(w).Encode(bitFieldSnapshot{
+		Size:   bf.size,
+		Curr:   bf.curr,
+		Bitmap: bf.encodeBitmapLocked(),
+	})
+}
+
+// Restore replaces bf's contents with the state previously written by
+// Snapshot. The snapshot must have been taken from a BitField of the same
+// size.
+func (bf *BitField) Restore(r io.Reader) error {
+	var snap bitFieldSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("bits: decoding bitfield snapshot: %w", err)
+	}
+	if snap.Size != bf.size {
+		return fmt.Errorf("bits: snapshot size %d does not match bitfield size %d", snap.Size, bf.size)
+	}
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.curr = snap.Curr
+	return bf.decodeBitmapLocked(snap.Bitmap)
+}
+
+// RangeAllocation is the persisted form of a PortRange: its startPort and
+// size (so a restore can be validated against the range it is applied to)
+// plus a compact base64 bitmap of which offsets are allocated. It mirrors
+// the snapshot struct used by Kubernetes' service PortAllocator.
+type RangeAllocation struct {
+	StartPort int    `json:"startPort"`
+	Size      int    `json:"size"`
+	Curr      int    `json:"curr"`
+	Bitmap    string `json:"bitmap"`
+}
+
+// Snapshot writes a RangeAllocation for pr to w so it can be reconstructed
+// later with Restore. Snapshotting is only supported for PortRanges backed
+// by a BitField (the default); a PortRange created with NewLargePortRange
+// is not yet snapshottable.
+func (pr *PortRange) Snapshot(w io.Writer) error {
+	bf, ok := pr.bitField.(*BitField)
+	if !ok {
+		return fmt.Errorf("bits: Snapshot is not supported for this PortRange's backing store")
+	}
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return json.NewEncoder(w).Encode(RangeAllocation{
+		StartPort: pr.startPort,
+		Size:      pr.size,
+		Curr:      bf.curr,
+		Bitmap:    bf.encodeBitmapLocked(),
+	})
+}
+
+// Restore replaces pr's allocations with a RangeAllocation previously
+// written by Snapshot. The snapshot must have been taken from a PortRange
+// with the same startPort and size, otherwise ErrMismatchedRange is
+// returned and pr is left untouched.
+func (pr *PortRange) Restore(r io.Reader) error {
+	bf, ok := pr.bitField.(*BitField)
+	if !ok {
+		return fmt.Errorf("bits: Restore is not supported for this PortRange's backing store")
+	}
+
+	var snap RangeAllocation
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("bits: decoding port range snapshot: %w", err)
+	}
+	if snap.StartPort != pr.startPort || snap.Size != pr.size {
+		return ErrMismatchedRange
+	}
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.curr = snap.Curr
+	return bf.decodeBitmapLocked(snap.Bitmap)
+}
+
+// encodeBitmapLocked packs bf's backing words into a little-endian byte
+// slice and base64-encodes it for compact, text-safe storage. Callers must
+// hold bf.mu.
+func (bf *BitField) encodeBitmapLocked() string {
+	buf := make([]byte, len(bf.bits)*8)
+	for i := range bf.bits {
+		binary.LittleEndian.PutUint64(buf[i*8:], bf.bits[i].Load())
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// decodeBitmapLocked unpacks a base64 bitmap produced by
+// encodeBitmapLocked back into bf's backing words. Callers must hold bf.mu.
+func (bf *BitField) decodeBitmapLocked(s string) error {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("bits: decoding bitmap: %w", err)
+	}
+	for i := range bf.bits {
+		var word uint64
+		if (i+1)*8 <= len(buf) {
+			word = binary.LittleEndian.Uint64(buf[i*8 : (i+1)*8])
+		}
+		bf.bits[i].Store(word)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package bits
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBitFieldSnapshotRestore(t *testing.T) {
+	bf := NewBitField(128)
+	bf.SetBit(5)
+	bf.SetBit(100)
+
+	var buf bytes.Buffer
+	if err := bf.Snapshot(&buf); err != nil {
+		t.Fatalf("Unexpected error snapshotting: %v", err)
+	}
+
+	restored := NewBitField(128)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Unexpected error restoring: %v", err)
+	}
+
+	if !restored.IsSet(5) || !restored.IsSet(100) {
+		t.Errorf("Expected restored bitfield to have bits 5 and 100 set")
+	}
+	if restored.IsSet(6) {
+		t.Errorf("Expected restored bitfield to have bit 6 unset")
+	}
+}
+
+func TestBitFieldRestoreSizeMismatch(t *testing.T) {
+	bf := NewBitField(128)
+	var buf bytes.Buffer
+	if err := bf.Snapshot(&buf); err != nil {
+		t.Fatalf("Unexpected error snapshotting: %v", err)
+	}
+
+	restored := NewBitField(64)
+	if err := restored.Restore(&buf); err == nil {
+		t.Fatal("Expected error restoring snapshot into a differently sized BitField")
+	}
+}
+
+func TestPortRangeSnapshotRestore(t *testing.T) {
+	pr, err := NewPortRange(8000, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := pr.AllocateNextPorts(3); err != nil {
+		t.Fatalf("Unexpected error allocating: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := pr.Snapshot(&buf); err != nil {
+		t.Fatalf("Unexpected error snapshotting: %v", err)
+	}
+
+	restored, err := NewPortRange(8000, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Unexpected error restoring: %v", err)
+	}
+
+	for _, port := range []int{8000, 8001, 8002} {
+		allocated, _ := restored.IsPortAllocated(port)
+		if !allocated {
+			t.Errorf("Expected port %d to be allocated after restore", port)
+		}
+	}
+	allocated, _ := restored.IsPortAllocated(8003)
+	if allocated {
+		t.Errorf("Expected port 8003 to be unallocated after restore")
+	}
+}
+
+func TestPortRangeRestoreMismatchedRange(t *testing.T) {
+	pr, err := NewPortRange(8000, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := pr.Snapshot(&buf); err != nil {
+		t.Fatalf("Unexpected error snapshotting: %v", err)
+	}
+
+	other, err := NewPortRange(9000, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := other.Restore(&buf); err != ErrMismatchedRange {
+		t.Fatalf("Expected ErrMismatchedRange, got %v", err)
+	}
+}
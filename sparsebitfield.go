@@ -0,0 +1,277 @@
+package bits
+
+import (
+	"fmt"
+	"sync"
+)
+
+// pageBits is the number of bits held by one SparseBitField leaf page.
+const pageBits = 4096
+
+// pageWords is the number of 64-bit words needed to hold one page.
+const pageWords = pageBits / wordSize
+
+// page is one fixed-size leaf of a SparseBitField's bitmap. popcount and
+// capacity let the owning SparseBitField tell, in O(1), whether the page
+// has any free bit left.
+type page struct {
+	words    [pageWords]uint64
+	popcount int
+	capacity int // number of valid bits in this page; < pageBits only for the last page
+}
+
+// SparseBitField is a bitset for ranges in the millions — e.g. the full
+// 1-65535 port space replicated across many IPs, or an IPAM-style /16
+// address pool — where allocating a single flat []uint64 would waste
+// memory that is never touched.
+//
+// It is a two-level, page-tree bitmap: a top-level slice indexes fixed-size
+// leaf pages, allocated lazily on first SetBit, and a summary BitField marks
+// which pages are completely full — the complement of "has a free bit" —
+// so a scan can reuse the summary's own AllocateAvailableBitsInRange to
+// jump straight to a page with room instead of visiting every page in
+// order.
+type SparseBitField struct {
+	mu      sync.Mutex
+	pages   []*page
+	summary *BitField
+	size    int
+}
+
+// NewSparseBitField returns a SparseBitField able to hold size bits, all
+// initially unset. No page storage is allocated until a bit within it is
+// first set.
+func NewSparseBitField(size int) *SparseBitField {
+	numPages := (size + pageBits - 1) / pageBits
+	return &SparseBitField{
+		pages:   make([]*page, numPages),
+		summary: NewBitField(numPages), // every page starts out unset, i.e. not full
+		size:    size,
+	}
+}
+
+func pageIndexOf(i int) (pageIdx, bitIdx int) {
+	return i / pageBits, i % pageBits
+}
+
+// ensurePageLocked returns the page at pageIdx, lazily allocating it. sb.mu
+// must be held.
+func (sb *SparseBitField) ensurePageLocked(pageIdx int) *page {
+	p := sb.pages[pageIdx]
+	if p == nil {
+		capacity := pageBits
+		if rem := sb.size - pageIdx*pageBits; rem < pageBits {
+			capacity = rem
+		}
+		p = &page{capacity: capacity}
+		sb.pages[pageIdx] = p
+	}
+	return p
+}
+
+// SetBit marks bit i as set.
+func (sb *SparseBitField) SetBit(i int) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	pageIdx, bitIdx := pageIndexOf(i)
+	p := sb.ensurePageLocked(pageIdx)
+	sb.setLocked(p, pageIdx, bitIdx)
+}
+
+func (sb *SparseBitField) setLocked(p *page, pageIdx, bitIdx int) {
+	widx, mask := bitIdx/wordSize, uint64(1)<<uint(bitIdx%wordSize)
+	if p.words[widx]&mask != 0 {
+		return
+	}
+	p.words[widx] |= mask
+	p.popcount++
+	if p.popcount == p.capacity {
+		sb.summary.SetBit(pageIdx) // mark the page full
+	}
+}
+
+// ClearBit marks bit i as unset.
+func (sb *SparseBitField) ClearBit(i int) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	pageIdx, bitIdx := pageIndexOf(i)
+	p := sb.pages[pageIdx]
+	if p == nil {
+		return
+	}
+	sb.clearLocked(p, pageIdx, bitIdx)
+}
+
+func (sb *SparseBitField) clearLocked(p *page, pageIdx, bitIdx int) {
+	widx, mask := bitIdx/wordSize, uint64(1)<<uint(bitIdx%wordSize)
+	if p.words[widx]&mask == 0 {
+		return
+	}
+	p.words[widx] &^= mask
+	p.popcount--
+	sb.summary.ClearBit(pageIdx) // the page now has at least one free bit again
+}
+
+// IsSet reports whether bit i is set.
+func (sb *SparseBitField) IsSet(i int) bool {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	pageIdx, bitIdx := pageIndexOf(i)
+	p := sb.pages[pageIdx]
+	if p == nil {
+		return false
+	}
+	widx, mask := bitIdx/wordSize, uint64(1)<<uint(bitIdx%wordSize)
+	return p.words[widx]&mask != 0
+}
+
+// nextFreePageFromLocked claims the lowest-indexed page at or after from
+// that the summary bitmap does not yet report as full, and returns its
+// index, without scanning any lower or already-full page. sb.mu must be
+// held. The claim is provisional: the summary bit is left set (as if the
+// page were full) until the caller's fillPageLocked call clears it back, so
+// within this one allocation the page can't be handed out twice.
+func (sb *SparseBitField) nextFreePageFromLocked(from int) (int, bool) {
+	idx, err := sb.summary.AllocateAvailableBitsInRange(from, len(sb.pages), 1)
+	if err != nil {
+		return 0, false
+	}
+	return idx[0], true
+}
+
+// fillPageLocked scans page pageIdx over the half-open bit range [lo, hi)
+// (clamped to the page's capacity), setting and recording unset bits until
+// *allocated holds n entries or the range is exhausted. It then clears the
+// page's summary bit if the page still has a free bit — a no-op unless the
+// page was provisionally claimed by nextFreePageFromLocked, in which case
+// this undoes that claim. sb.mu must be held.
+func (sb *SparseBitField) fillPageLocked(pageIdx, lo, hi, n int, allocated *[]int) {
+	p := sb.ensurePageLocked(pageIdx)
+	if hi > p.capacity {
+		hi = p.capacity
+	}
+	base := pageIdx * pageBits
+	for bitIdx := lo; bitIdx < hi && len(*allocated) < n; bitIdx++ {
+		widx, mask := bitIdx/wordSize, uint64(1)<<uint(bitIdx%wordSize)
+		if p.words[widx]&mask == 0 {
+			sb.setLocked(p, pageIdx, bitIdx)
+			*allocated = append(*allocated, base+bitIdx)
+		}
+	}
+	if p.popcount < p.capacity {
+		sb.summary.ClearBit(pageIdx)
+	}
+}
+
+// AllocateNextAvailableBits finds the first n unset bits, marks them set,
+// and returns their positions in ascending order. Instead of walking every
+// page in order, each time it needs a new page it uses the summary
+// bitmap's own AllocateAvailableBitsInRange to jump straight to the next
+// one with a free bit, resuming just past the last page it looked at so a
+// request spanning several pages never rescans one it has already ruled
+// out. Because the search always starts this fresh call at page 0, results
+// are still the same lowest-free-bit-first, ascending order a plain page-
+// by-page scan would produce.
+func (sb *SparseBitField) AllocateNextAvailableBits(n int) ([]int, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("bits: invalid bit count %d", n)
+	}
+	if n > sb.size {
+		return nil, fmt.Errorf("bits: requested %d bits but field only holds %d", n, sb.size)
+	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	allocated := make([]int, 0, n)
+	from := 0
+	for len(allocated) < n {
+		pageIdx, ok := sb.nextFreePageFromLocked(from)
+		if !ok {
+			break
+		}
+		sb.fillPageLocked(pageIdx, 0, pageBits, n, &allocated)
+		from = pageIdx + 1
+	}
+
+	if len(allocated) < n {
+		sb.rollbackLocked(allocated)
+		return nil, fmt.Errorf("%w: requested %d, found %d", ErrNoBitAvailable, n, len(allocated))
+	}
+	return allocated, nil
+}
+
+// rollbackLocked clears every bit in allocated. sb.mu must be held. It is
+// used to undo a partial scan that found fewer than the requested number of
+// bits, so a failed allocation never leaves bits permanently claimed that
+// the caller was never told about.
+func (sb *SparseBitField) rollbackLocked(allocated []int) {
+	for _, idx := range allocated {
+		pageIdx, bitIdx := pageIndexOf(idx)
+		sb.clearLocked(sb.pages[pageIdx], pageIdx, bitIdx)
+	}
+}
+
+// AllocateAvailableBitsInRange behaves like AllocateNextAvailableBits but
+// restricts the search to the half-open range [start, end).
+func (sb *SparseBitField) AllocateAvailableBitsInRange(start, end, n int) ([]int, error) {
+	if start < 0 || end > sb.size || start >= end {
+		return nil, fmt.Errorf("bits: invalid range [%d, %d)", start, end)
+	}
+	if n <= 0 || n > end-start {
+		return nil, fmt.Errorf("bits: invalid bit count %d for range [%d, %d)", n, start, end)
+	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	allocated := make([]int, 0, n)
+	startPage, _ := pageIndexOf(start)
+	endPage, _ := pageIndexOf(end - 1)
+	// A caller-specified sub-range only ever spans a handful of pages, so
+	// (unlike AllocateNextAvailableBits) there's no benefit to jumping
+	// through the summary bitmap here — just walk the bounded page span,
+	// skipping any page the summary already reports as full.
+	for pageIdx := startPage; pageIdx <= endPage && len(allocated) < n; pageIdx++ {
+		if sb.summary.IsSet(pageIdx) {
+			continue
+		}
+		base := pageIdx * pageBits
+		lo := 0
+		if start > base {
+			lo = start - base
+		}
+		hi := pageBits
+		if end < base+pageBits {
+			hi = end - base
+		}
+		sb.fillPageLocked(pageIdx, lo, hi, n, &allocated)
+	}
+
+	if len(allocated) < n {
+		sb.rollbackLocked(allocated)
+		return nil, fmt.Errorf("%w in range [%d, %d): requested %d, found %d", ErrNoBitAvailable, start, end, n, len(allocated))
+	}
+	return allocated, nil
+}
+
+// Free returns the number of currently unset bits across the whole field.
+// Pages that have never been touched are entirely free, without needing to
+// be allocated just to be counted.
+func (sb *SparseBitField) Free() int {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	free := 0
+	for pageIdx, p := range sb.pages {
+		if p == nil {
+			capacity := pageBits
+			if rem := sb.size - pageIdx*pageBits; rem < pageBits {
+				capacity = rem
+			}
+			free += capacity
+			continue
+		}
+		free += p.capacity - p.popcount
+	}
+	return free
+}
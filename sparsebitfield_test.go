@@ -0,0 +1,202 @@
+package bits
+
+import "testing"
+
+func TestSparseBitFieldSetClearIsSet(t *testing.T) {
+	sb := NewSparseBitField(20000)
+
+	sb.SetBit(5)
+	sb.SetBit(10000)
+	if !sb.IsSet(5) || !sb.IsSet(10000) {
+		t.Errorf("Expected bits 5 and 10000 to be set")
+	}
+	if sb.IsSet(6) {
+		t.Errorf("Expected bit 6 to be unset")
+	}
+
+	sb.ClearBit(5)
+	if sb.IsSet(5) {
+		t.Errorf("Expected bit 5 to be cleared")
+	}
+	// Clearing an unset bit, including one in a never-touched page, must
+	// not panic or allocate that page.
+	sb.ClearBit(15000)
+}
+
+func TestSparseBitFieldAllocateNextAvailableBits(t *testing.T) {
+	sb := NewSparseBitField(10000)
+	sb.SetBit(1)
+	sb.SetBit(3)
+
+	allocated, err := sb.AllocateNextAvailableBits(3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{0, 2, 4}
+	for i, pos := range allocated {
+		if pos != expected[i] {
+			t.Errorf("Expected allocated bits %v, got %v", expected, allocated)
+		}
+	}
+
+	// Fill an entire page so the summary bitmap must skip it on the next
+	// call rather than scanning it bit by bit.
+	filled, err := sb.AllocateNextAvailableBits(pageBits - 5)
+	if err != nil {
+		t.Fatalf("Unexpected error filling page: %v", err)
+	}
+	if len(filled) != pageBits-5 {
+		t.Fatalf("Expected to fill the rest of the first page, got %d bits", len(filled))
+	}
+
+	next, err := sb.AllocateNextAvailableBits(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if next[0] < pageBits {
+		t.Errorf("Expected allocation to skip the full first page, got %d", next[0])
+	}
+}
+
+func TestSparseBitFieldAllocateNextAvailableBitsStaysAscending(t *testing.T) {
+	sb := NewSparseBitField(3 * pageBits)
+
+	if _, err := sb.AllocateNextAvailableBits(pageBits); err != nil { // fills page 0
+		t.Fatalf("Unexpected error filling page 0: %v", err)
+	}
+	if _, err := sb.AllocateNextAvailableBits(1); err != nil { // lands in page 1
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sb.ClearBit(0) // free the lowest bit in page 0 again
+
+	// A fresh call must still find the lowest free bit first, even though
+	// the previous call's page-to-page search had already moved past page 0.
+	next, err := sb.AllocateNextAvailableBits(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if next[0] != 0 {
+		t.Fatalf("Expected the lowest free bit (0), got %d", next[0])
+	}
+
+	// A single request spanning several fresh pages must come back ascending.
+	sbWide := NewSparseBitField(5 * pageBits)
+	wide, err := sbWide.AllocateNextAvailableBits(2*pageBits + 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 1; i < len(wide); i++ {
+		if wide[i] <= wide[i-1] {
+			t.Fatalf("Expected strictly ascending indices, got %v", wide)
+		}
+	}
+}
+
+func TestSparseBitFieldAllocateAvailableBitsInRange(t *testing.T) {
+	sb := NewSparseBitField(10000)
+	sb.SetBit(1)
+	sb.SetBit(3)
+	sb.SetBit(7)
+
+	available, err := sb.AllocateAvailableBitsInRange(0, 5, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{0, 2}
+	for i, pos := range available {
+		if pos != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, available)
+		}
+	}
+
+	if _, err := sb.AllocateAvailableBitsInRange(0, 5, 4); err == nil {
+		t.Fatal("Expected error due to insufficient consecutive bits")
+	}
+
+	if _, err := sb.AllocateAvailableBitsInRange(-1, 15, 2); err == nil {
+		t.Fatal("Expected error due to out-of-bounds range")
+	}
+}
+
+func TestSparseBitFieldAllocateRollsBackOnFailure(t *testing.T) {
+	sb := NewSparseBitField(10)
+	sb.SetBit(7)
+	sb.SetBit(8)
+	sb.SetBit(9)
+
+	if _, err := sb.AllocateNextAvailableBits(8); err == nil {
+		t.Fatal("Expected error due to insufficient available bits")
+	}
+	if got := sb.Free(); got != 7 {
+		t.Fatalf("Expected a failed allocation to leave all scanned bits free, got %d free", got)
+	}
+
+	if _, err := sb.AllocateAvailableBitsInRange(0, 5, 6); err == nil {
+		t.Fatal("Expected error due to insufficient bits in range")
+	}
+	if got := sb.Free(); got != 7 {
+		t.Fatalf("Expected a failed ranged allocation to leave all scanned bits free, got %d free", got)
+	}
+}
+
+func TestSparseBitFieldFree(t *testing.T) {
+	sb := NewSparseBitField(10000)
+	if got := sb.Free(); got != 10000 {
+		t.Fatalf("Expected 10000 free bits initially, got %d", got)
+	}
+
+	allocated, err := sb.AllocateNextAvailableBits(3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := sb.Free(); got != 9997 {
+		t.Fatalf("Expected 9997 free bits, got %d", got)
+	}
+
+	for _, i := range allocated {
+		sb.ClearBit(i)
+	}
+	if got := sb.Free(); got != 10000 {
+		t.Fatalf("Expected Free to return to its initial value, got %d", got)
+	}
+}
+
+func TestSparseBitFieldInvalidInput(t *testing.T) {
+	sb := NewSparseBitField(100)
+
+	if _, err := sb.AllocateNextAvailableBits(0); err == nil {
+		t.Errorf("Expected error for invalid bit count (0)")
+	}
+	if _, err := sb.AllocateNextAvailableBits(101); err == nil {
+		t.Errorf("Expected error for bit count exceeding field size")
+	}
+}
+
+func TestNewLargePortRange(t *testing.T) {
+	pr, err := NewLargePortRange(1, 65535)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	allocated, err := pr.AllocateNextPorts(3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{1, 2, 3}
+	for i, port := range allocated {
+		if port != expected[i] {
+			t.Errorf("Expected allocated ports %v, got %v", expected, allocated)
+		}
+	}
+
+	if err := pr.ReleasePorts([]int{2}); err != nil {
+		t.Fatalf("Unexpected error releasing port: %v", err)
+	}
+	isAllocated, err := pr.IsPortAllocated(2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if isAllocated {
+		t.Errorf("Expected port 2 to be released")
+	}
+}